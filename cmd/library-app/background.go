@@ -0,0 +1,21 @@
+package main
+
+// background runs fn in a new goroutine that is tracked by the application's
+// WaitGroup, so that serve() can wait for in-flight jobs (such as sending an
+// email) to finish before the process exits. A panic inside fn is recovered
+// and logged instead of crashing the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Printf("background job panic: %v", err)
+			}
+		}()
+
+		fn()
+	}()
+}
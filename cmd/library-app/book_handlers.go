@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"api/pkg/library-app/models"
 	"api/pkg/library-app/validator"
@@ -12,6 +17,7 @@ func (app *application) GetBooks(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Title         string
 		Author        string
+		Q             string
 		PublishedYear int
 		models.Filters
 	}
@@ -23,6 +29,10 @@ func (app *application) GetBooks(w http.ResponseWriter, r *http.Request) {
 	// by the client.
 	input.Title = app.readString(qs, "title", "")
 	input.Author = app.readString(qs, "author", "")
+	// q runs a ranked full-text search across title and author instead of
+	// matching them independently; when present it takes priority over the
+	// title/author params, which are kept for back-compat.
+	input.Q = app.readString(qs, "q", "")
 	input.PublishedYear = app.readInt(qs, "publishedyear", 1, v)
 	// Get the page and page_size query string value as integers. Notice that we set the default
 	// page value to 1 and default page_size to 20, and that we pass the validator instance
@@ -40,9 +50,21 @@ func (app *application) GetBooks(w http.ResponseWriter, r *http.Request) {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+
+	// Bulk consumers can ask for CSV or NDJSON instead of the usual JSON
+	// envelope, either via the Accept header or a `?format=` override.
+	switch negotiateFormat(r) {
+	case "csv":
+		app.streamBooksCSV(w, r, input.Title, input.Author, input.Q, input.Filters)
+		return
+	case "ndjson":
+		app.streamBooksNDJSON(w, r, input.Title, input.Author, input.Q, input.Filters)
+		return
+	}
+
 	// Call the GetAll() method to retrieve the movies, passing in the various filter
 	// parameters.
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Author, input.Filters)
+	books, metadata, err := app.models.Books.GetAll(input.Title, input.Author, input.Q, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -53,6 +75,89 @@ func (app *application) GetBooks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// negotiateFormat picks the response format for GetBooks: an explicit
+// `?format=` query parameter wins, otherwise it's derived from the Accept
+// header, falling back to the default JSON envelope.
+func negotiateFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	switch accept := r.Header.Get("Accept"); {
+	case strings.Contains(accept, "text/csv"):
+		return "csv"
+	case strings.Contains(accept, "application/x-ndjson"):
+		return "ndjson"
+	default:
+		return "json"
+	}
+}
+
+// streamBooksCSV streams matching books as CSV, flushing after every row so
+// large result sets don't have to be buffered in memory on either end.
+func (app *application) streamBooksCSV(w http.ResponseWriter, r *http.Request, title, author, q string, filters models.Filters) {
+	stream, err := app.models.Books.GetAllStream(r.Context(), title, author, q, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming unsupported by response writer"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "author", "publishedYear", "createdAt", "updatedAt", "highlight"})
+	cw.Flush()
+	flusher.Flush()
+
+	for book := range stream {
+		cw.Write([]string{
+			strconv.Itoa(book.Id),
+			book.Title,
+			book.Author,
+			strconv.Itoa(book.PublishedYear),
+			book.CreatedAt,
+			book.UpdatedAt,
+			book.Highlight,
+		})
+		cw.Flush()
+		flusher.Flush()
+	}
+}
+
+// streamBooksNDJSON streams matching books as newline-delimited JSON
+// objects, flushing after every row.
+func (app *application) streamBooksNDJSON(w http.ResponseWriter, r *http.Request, title, author, q string, filters models.Filters) {
+	stream, err := app.models.Books.GetAllStream(r.Context(), title, author, q, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming unsupported by response writer"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+
+	for book := range stream {
+		if err := enc.Encode(book); err != nil {
+			app.errorLog.Printf("streaming book as ndjson: %v", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 func (app *application) GetBook(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil || id < 1 {
@@ -72,7 +177,36 @@ func (app *application) GetBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
+	app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers)
+}
+
+// bookETag derives a weak ETag from the book's version so that clients can
+// make conditional requests (If-Match) against it. It's weak (the "W/"
+// prefix) because version only tracks logical edits, not byte-for-byte
+// equivalence of the representation.
+func bookETag(book *models.Book) string {
+	return fmt.Sprintf(`W/"%d"`, book.Version)
+}
+
+// checkIfMatch compares the If-Match request header, if present, against the
+// current version of book. It reports whether the request should proceed.
+func checkIfMatch(r *http.Request, book *models.Book) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	ifMatch = strings.TrimPrefix(ifMatch, "W/")
+
+	version, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+	if err != nil {
+		return false
+	}
+
+	return version == book.Version
 }
 
 func (app *application) CreateBook(w http.ResponseWriter, r *http.Request) {
@@ -125,7 +259,70 @@ func (app *application) DeleteBook(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, envelope{"message": "success", "deleted_book": book}, nil)
 }
 
-func (app *application) UpdateBook(w http.ResponseWriter, r *http.Request) {
+// ReplaceBook handles PUT requests and requires the full representation of
+// the book to be supplied, replacing it wholesale. It is idempotent: issuing
+// the same request twice leaves the book in the same state (modulo the
+// version bump), and honors If-Match for optimistic concurrency control.
+func (app *application) ReplaceBook(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := app.models.Books.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !checkIfMatch(r, book) {
+		app.editConflictResponse(w, r, http.StatusPreconditionFailed)
+		return
+	}
+
+	var input struct {
+		Title         *string `json:"title"`
+		Author        *string `json:"author"`
+		PublishedYear *int    `json:"publishedYear"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Title != nil, "title", "must be provided")
+	v.Check(input.Author != nil, "author", "must be provided")
+	v.Check(input.PublishedYear != nil, "publishedYear", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book.Title = *input.Title
+	book.Author = *input.Author
+	book.PublishedYear = *input.PublishedYear
+
+	if models.ValidateBook(v, book); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.updateBook(w, r, book)
+}
+
+// PatchBook handles PATCH requests and accepts a partial representation of
+// the book, updating only the fields that were supplied.
+func (app *application) PatchBook(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil || id < 1 {
 		app.notFoundResponse(w, r)
@@ -143,6 +340,11 @@ func (app *application) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkIfMatch(r, book) {
+		app.editConflictResponse(w, r, http.StatusPreconditionFailed)
+		return
+	}
+
 	var input struct {
 		Title         *string `json:"title"`
 		Author        *string `json:"author"`
@@ -175,12 +377,27 @@ func (app *application) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Books.Update(book)
+	app.updateBook(w, r, book)
+}
+
+// updateBook persists book, mapping a version mismatch detected at the
+// database level (another writer got there first, between our Get and this
+// Update) to a 409 Conflict, as distinct from the 412 Precondition Failed
+// returned when the client's own If-Match header is already stale.
+func (app *application) updateBook(w http.ResponseWriter, r *http.Request, book *models.Book) {
+	err := app.models.Books.Update(book)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r, http.StatusConflict)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
 
+	app.writeJSON(w, http.StatusOK, envelope{"book": book}, headers)
 }
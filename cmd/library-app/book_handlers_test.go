@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api/pkg/library-app/models"
+)
+
+func TestBookETagIsWeak(t *testing.T) {
+	book := &models.Book{Version: 5}
+
+	got := bookETag(book)
+	want := `W/"5"`
+
+	if got != want {
+		t.Errorf("bookETag(book) = %q, want %q", got, want)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	book := &models.Book{Version: 5}
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    bool
+	}{
+		{name: "no header", ifMatch: "", want: true},
+		{name: "matching strong etag", ifMatch: `"5"`, want: true},
+		{name: "matching weak etag", ifMatch: `W/"5"`, want: true},
+		{name: "stale version", ifMatch: `"4"`, want: false},
+		{name: "not a version", ifMatch: "garbage", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/v1/books/1", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			if got := checkIfMatch(r, book); got != tt.want {
+				t.Errorf("checkIfMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
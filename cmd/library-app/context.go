@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"api/pkg/library-app/models"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// contextSetUser returns a copy of r with user stashed in its context, for
+// retrieval later in the handler chain via contextGetUser.
+func contextSetUser(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser retrieves the *models.User previously stored on r's context
+// by requireAuthenticatedUser. It panics if called from a handler that isn't
+// wrapped by that middleware, since that's a programmer error.
+func contextGetUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
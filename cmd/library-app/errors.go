@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// editConflictResponse reports that the client's write couldn't be applied
+// because the resource has moved on since they last read it. status is
+// http.StatusConflict (409) when the conflict was only detected at the
+// database level — another writer won the race between our read and this
+// write — and http.StatusPreconditionFailed (412) when the client's own
+// If-Match header was already stale before we even touched the database.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status, "unable to update the record due to an edit conflict, please try again")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// metrics wraps every request with httpsnoop so the response status code and
+// duration can be captured without manually wrapping http.ResponseWriter,
+// and tallies them into the expvar counters exposed at /debug/vars.
+func (app *application) metrics(next http.Handler) http.Handler {
+	totalRequestsReceived := expvar.NewInt("total_requests_received")
+	totalResponsesSent := expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds := expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus := expvar.NewMap("total_responses_sent_by_status")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		totalRequestsReceived.Add(1)
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+
+		totalResponsesSent.Add(1)
+		totalResponsesSentByStatus.Add(strconv.Itoa(metrics.Code), 1)
+		totalProcessingTimeMicroseconds.Add(metrics.Duration.Microseconds())
+	})
+}
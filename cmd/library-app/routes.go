@@ -0,0 +1,28 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) routes() http.Handler {
+	router := httprouter.New()
+
+	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+
+	router.HandlerFunc(http.MethodGet, "/v1/books", app.GetBooks)
+	router.HandlerFunc(http.MethodPost, "/v1/books", app.requirePermission("books:write", app.CreateBook))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.GetBook)
+	router.HandlerFunc(http.MethodPut, "/v1/books/:id", app.requirePermission("books:write", app.ReplaceBook))
+	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", app.requirePermission("books:write", app.PatchBook))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.requirePermission("books:write", app.DeleteBook))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/subscribe", app.requireActivatedUser(app.SubcribeAtBook))
+	router.HandlerFunc(http.MethodGet, "/v1/books/favorites", app.requireActivatedUser(app.GetFavoriteBooks))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+
+	return app.metrics(app.logRequest(app.rateLimit(router)))
+}
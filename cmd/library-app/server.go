@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve starts the HTTP server and blocks until it is shut down, either
+// because ListenAndServe returned an unexpected error or because a SIGINT /
+// SIGTERM was received and the graceful shutdown below completed.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		ErrorLog:     app.errorLog,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.infoLog.Printf("shutting down server signal=%s", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			shutdownError <- err
+			return
+		}
+
+		// Wait for any in-flight background jobs (activation emails,
+		// subscription notifications, ...) to finish before we let the
+		// process exit.
+		app.infoLog.Printf("waiting for background jobs to complete")
+		app.wg.Wait()
+
+		shutdownError <- nil
+	}()
+
+	app.infoLog.Printf("starting %s server addr=%s", app.config.env, srv.Addr)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("stopped server addr=%s", srv.Addr)
+
+	return nil
+}
@@ -10,25 +10,9 @@ import (
 )
 
 func (app *application) SubcribeAtBook(w http.ResponseWriter, r *http.Request) {
-	token, err := app.GetToken(w, r)
-	if err != nil {
-		app.invalidCredentialsResponse(w, r)
-		return
-	}
-	// Retrieve the details of the user associated with the authentication token,
-	// again calling the invalidAuthenticationTokenResponse() helper if no
-	// matching record was found. IMPORTANT: Notice that we are using
-	// ScopeAuthentication as the first parameter here.
-	user, err := app.models.Users.GetByToken(models.ScopeAuthentication, token)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.invalidAuthenticationTokenResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
+	// The requireActivatedUser middleware has already authenticated the
+	// caller and stashed the matching user on the request context.
+	user := contextGetUser(r)
 
 	id, err := app.readIDParam(r)
 	if err != nil || id < 1 {
@@ -55,27 +39,27 @@ func (app *application) SubcribeAtBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Let the user know their subscription went through without blocking the
+	// response on an SMTP round-trip.
+	app.background(func() {
+		data := map[string]interface{}{
+			"Book": book,
+		}
+
+		err := app.mailer.Send(user.Email, "book_subscription.tmpl", data)
+		if err != nil {
+			app.errorLog.Printf("failed to send subscription confirmation email to %s: %v", user.Email, err)
+		}
+	})
+
 	app.writeJSON(w, http.StatusCreated, envelope{"subscribe at": book}, nil)
 }
 
 func (app *application) GetFavoriteBooks(w http.ResponseWriter, r *http.Request) {
-	token, err := app.GetToken(w, r)
+	// The requireActivatedUser middleware has already authenticated the
+	// caller and stashed the matching user on the request context.
+	user := contextGetUser(r)
 
-	if err != nil {
-		app.invalidCredentialsResponse(w, r)
-		return
-	}
-
-	user, err := app.models.Users.GetByToken(models.ScopeAuthentication, token)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			app.invalidAuthenticationTokenResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
-		return
-	}
 	books, err := app.models.Users.GetFavorites(int(user.ID))
 	if err != nil {
 		switch {
@@ -161,6 +145,20 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	res.Token = token.Plaintext
 	res.User = user
 
+	// Send the activation email in the background so the client doesn't have
+	// to wait on a slow SMTP round-trip before getting a response.
+	app.background(func() {
+		data := map[string]interface{}{
+			"ActivationToken": token.Plaintext,
+			"UserID":          user.ID,
+		}
+
+		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.errorLog.Printf("failed to send activation email to %s: %v", user.Email, err)
+		}
+	})
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": res}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -204,7 +202,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrEditConflict):
-			app.editConflictResponse(w, r)
+			app.editConflictResponse(w, r, http.StatusConflict)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -217,6 +215,13 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	// Activated users can write to the catalog, so grant the "books:write"
+	// permission now that activation has succeeded.
+	err = app.models.Permissions.AddForUser(user.ID, "books:write")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Send the updated user details to the client in a JSON response.
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -17,24 +18,51 @@ type Book struct {
 	PublishedYear int    `json:"publishedYear"`
 	CreatedAt     string `json:"createdAt"`
 	UpdatedAt     string `json:"updatedAt"`
+	Version       int    `json:"version"`
+	// Highlight holds a ts_headline() snippet with the matched search terms
+	// marked up. It's only populated when a `q` query param was supplied: by
+	// the ranked/fuzzy search path in GetAll and by the ranked query in
+	// GetAllStream.
+	Highlight string `json:"highlight,omitempty"`
 }
 
 type BookModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	// Timeout bounds every query issued by this model. It defaults to 3
+	// seconds if left unset, but callers (see models.NewModels) are expected
+	// to populate it from the application config.
+	Timeout time.Duration
 }
 
-func (m BookModel) GetAll(title string, author string, filters Filters) ([]*Book, Metadata, error) {
+// queryTimeout returns m.Timeout, falling back to a sane default for
+// BookModel values that were constructed without one set explicitly.
+func (m BookModel) queryTimeout() time.Duration {
+	if m.Timeout <= 0 {
+		return 3 * time.Second
+	}
+	return m.Timeout
+}
+
+// GetAll retrieves books matching the given filters. When q is non-empty it
+// takes priority over title/author and runs a ranked full-text search
+// (falling back to trigram similarity for typo tolerance, see search());
+// otherwise title/author are matched independently as before.
+func (m BookModel) GetAll(title string, author string, q string, filters Filters) ([]*Book, Metadata, error) {
+	if q != "" {
+		return m.search(q, filters)
+	}
+
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, title, author, publishedyear, created_at, updated_at
+		SELECT count(*) OVER(), id, title, author, publishedyear, created_at, updated_at, version
 		FROM books
 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '')
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
 	defer cancel()
 	// As our SQL query now has quite a few placeholder parameters, let's collect the
 	// values for the placeholders in a slice. Notice here how we call the limit() and
@@ -60,6 +88,7 @@ func (m BookModel) GetAll(title string, author string, filters Filters) ([]*Book
 			&book.PublishedYear,
 			&book.CreatedAt,
 			&book.UpdatedAt,
+			&book.Version,
 		)
 
 		if err != nil {
@@ -78,23 +107,201 @@ func (m BookModel) GetAll(title string, author string, filters Filters) ([]*Book
 	return books, metadata, nil
 }
 
+// search ranks books against the generated tsv column using
+// websearch_to_tsquery, which understands phrases and +/- modifiers the way
+// a search engine does. If that yields no rows - most often because q has a
+// typo - it re-runs against the pg_trgm indexes on title/author instead,
+// ranking by similarity. Either way, each row carries a ts_headline snippet
+// marking the words that match q's terms as a full-text query; in the
+// trigram fallback a word that only matches by similarity is not marked.
+func (m BookModel) search(q string, filters Filters) ([]*Book, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
+	defer cancel()
+
+	args := []interface{}{q, filters.limit(), filters.offset()}
+
+	rankedQuery := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, title, author, publishedyear, created_at, updated_at, version,
+			ts_headline('english', title || ' ' || author, websearch_to_tsquery('english', $1)) AS highlight
+		FROM books
+		WHERE tsv @@ websearch_to_tsquery('english', $1)
+		ORDER BY ts_rank_cd(tsv, websearch_to_tsquery('english', $1)) DESC, %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	books, totalRecords, err := m.scanSearchRows(ctx, rankedQuery, args)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if len(books) > 0 {
+		return books, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+	}
+
+	fuzzyQuery := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, title, author, publishedyear, created_at, updated_at, version,
+			ts_headline('english', title || ' ' || author, plainto_tsquery('english', $1)) AS highlight
+		FROM books
+		WHERE title %% $1 OR author %% $1
+		ORDER BY GREATEST(similarity(title, $1), similarity(author, $1)) DESC, %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	books, totalRecords, err = m.scanSearchRows(ctx, fuzzyQuery, args)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return books, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// scanSearchRows executes query (one of the two search variants, both of
+// which project the same count(*) OVER(), Book columns, highlight shape) and
+// returns the scanned books along with the total record count reported by
+// the window function.
+func (m BookModel) scanSearchRows(ctx context.Context, query string, args []interface{}) ([]*Book, int, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&totalRecords,
+			&book.Id,
+			&book.Title,
+			&book.Author,
+			&book.PublishedYear,
+			&book.CreatedAt,
+			&book.UpdatedAt,
+			&book.Version,
+			&book.Highlight,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return books, totalRecords, nil
+}
+
+// GetAllStream runs the same filter/sort/pagination query as GetAll, but
+// scans rows into a channel as they arrive instead of buffering the whole
+// result set in memory, so handlers can stream very large result sets
+// straight to the response. The channel is closed once the query is
+// exhausted, an error occurs, or ctx is done; scan/iteration errors are
+// logged to m.ErrorLog rather than returned, since the channel has no way to
+// carry them back to the caller once streaming has started.
+//
+// When q is non-empty it's ranked the same way as the first pass of search(),
+// with each book's Highlight populated; unlike search() there's no trigram
+// fallback on an empty ranked result, since that would mean re-running the
+// whole query after we've already started streaming rows to the client.
+func (m BookModel) GetAllStream(ctx context.Context, title string, author string, q string, filters Filters) (<-chan *Book, error) {
+	var query string
+	var args []interface{}
+
+	if q != "" {
+		query = fmt.Sprintf(`
+			SELECT id, title, author, publishedyear, created_at, updated_at, version,
+				ts_headline('english', title || ' ' || author, websearch_to_tsquery('english', $1)) AS highlight
+			FROM books
+			WHERE tsv @@ websearch_to_tsquery('english', $1)
+			ORDER BY ts_rank_cd(tsv, websearch_to_tsquery('english', $1)) DESC, %s %s, id ASC
+			LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+		args = []interface{}{q, filters.limit(), filters.offset()}
+	} else {
+		query = fmt.Sprintf(`
+			SELECT id, title, author, publishedyear, created_at, updated_at, version
+			FROM books
+			WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+			AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '')
+			ORDER BY %s %s, id ASC
+			LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		args = []interface{}{title, author, filters.limit(), filters.offset()}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := make(chan *Book)
+
+	go func() {
+		defer close(stream)
+		defer rows.Close()
+
+		for rows.Next() {
+			var book Book
+			var err error
+			if q != "" {
+				err = rows.Scan(
+					&book.Id,
+					&book.Title,
+					&book.Author,
+					&book.PublishedYear,
+					&book.CreatedAt,
+					&book.UpdatedAt,
+					&book.Version,
+					&book.Highlight,
+				)
+			} else {
+				err = rows.Scan(
+					&book.Id,
+					&book.Title,
+					&book.Author,
+					&book.PublishedYear,
+					&book.CreatedAt,
+					&book.UpdatedAt,
+					&book.Version,
+				)
+			}
+			if err != nil {
+				m.ErrorLog.Printf("GetAllStream: scanning row: %v", err)
+				return
+			}
+
+			select {
+			case stream <- &book:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			m.ErrorLog.Printf("GetAllStream: iterating rows: %v", err)
+		}
+	}()
+
+	return stream, nil
+}
+
 func (m BookModel) Get(id int) (*Book, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, title, author, publishedYear, created_at, updated_at
+		SELECT id, title, author, publishedYear, created_at, updated_at, version
 		FROM books
 		WHERE id = $1
 		`
 
 	var book Book
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&book.Id, &book.Title, &book.Author, &book.PublishedYear, &book.CreatedAt, &book.UpdatedAt)
+	err := row.Scan(&book.Id, &book.Title, &book.Author, &book.PublishedYear, &book.CreatedAt, &book.UpdatedAt, &book.Version)
 
 	if err != nil {
 		return nil, ErrRecordNotFound
@@ -105,16 +312,16 @@ func (m BookModel) Get(id int) (*Book, error) {
 
 func (m BookModel) Insert(book *Book) error {
 	query := `
-		INSERT INTO books (title, author, publishedYear) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, created_at, updated_at
+		INSERT INTO books (title, author, publishedYear)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at, version
 	`
 
 	args := []interface{}{book.Title, book.Author, book.PublishedYear}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&book.Id, &book.CreatedAt, &book.UpdatedAt)
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&book.Id, &book.CreatedAt, &book.UpdatedAt, &book.Version)
 }
 
 func (m BookModel) Delete(id int) error {
@@ -125,7 +332,7 @@ func (m BookModel) Delete(id int) error {
 		DELETE FROM books
 		WHERE id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, id)
@@ -136,15 +343,25 @@ func (m BookModel) Update(book *Book) error {
 
 	query := `
 		UPDATE books
-		SET title = $1, author = $2, publishedyear = $3, updated_at = NOW()
-		WHERE id = $4
-		RETURNING updated_at
+		SET title = $1, author = $2, publishedyear = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING updated_at, version
 		`
-	args := []interface{}{book.Title, book.Author, book.PublishedYear, book.Id}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []interface{}{book.Title, book.Author, book.PublishedYear, book.Id, book.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout())
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&book.UpdatedAt)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&book.UpdatedAt, &book.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
 func ValidateBook(v *validator.Validator, book *Book) {
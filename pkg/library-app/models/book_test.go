@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestBookModel(t *testing.T) (BookModel, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return BookModel{DB: db, Timeout: time.Second}, mock
+}
+
+func TestSearchFallsBackToTrigramWhenRankedSearchHasNoRows(t *testing.T) {
+	m, mock := newTestBookModel(t)
+
+	columns := []string{"count", "id", "title", "author", "publishedyear", "created_at", "updated_at", "version", "highlight"}
+
+	mock.ExpectQuery("WHERE tsv @@ websearch_to_tsquery").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	mock.ExpectQuery("WHERE title % \\$1 OR author % \\$1").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 7, "The Great Gatbsy", "F. Scott Fitzgerald", 1925, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z", 1, "The Great <b>Gatbsy</b>"))
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+
+	books, metadata, err := m.search("gatbsy", filters)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(books) != 1 {
+		t.Fatalf("expected 1 book from the trigram fallback, got %d", len(books))
+	}
+
+	if books[0].Title != "The Great Gatbsy" {
+		t.Errorf("unexpected title %q", books[0].Title)
+	}
+
+	if metadata.TotalRecords != 1 {
+		t.Errorf("metadata.TotalRecords = %d, want 1", metadata.TotalRecords)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSearchUsesRankedResultsWithoutFallingBack(t *testing.T) {
+	m, mock := newTestBookModel(t)
+
+	columns := []string{"count", "id", "title", "author", "publishedyear", "created_at", "updated_at", "version", "highlight"}
+
+	mock.ExpectQuery("WHERE tsv @@ websearch_to_tsquery").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 3, "Go in Action", "William Kennedy", 2015, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z", 1, "<b>Go</b> in Action"))
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+
+	books, _, err := m.search("go", filters)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(books) != 1 {
+		t.Fatalf("expected 1 book from the ranked search, got %d", len(books))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Models bundles every table-backed model the application talks to, each
+// constructed against the same *sql.DB connection pool.
+type Models struct {
+	Books       BookModel
+	Users       UserModel
+	Tokens      TokenModel
+	Permissions PermissionModel
+}
+
+// NewModels wires up Models against db, threading timeout and the
+// application's loggers through to BookModel, whose queries need a
+// configurable deadline and log scan/iteration errors encountered while
+// streaming (see BookModel.GetAllStream).
+func NewModels(db *sql.DB, timeout time.Duration, infoLog, errorLog *log.Logger) Models {
+	return Models{
+		Books: BookModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Users:       UserModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+	}
+}